@@ -1,24 +1,34 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
+	"github.com/whats-this/bitscan/filer"
+	"github.com/whats-this/bitscan/metrics"
+	"github.com/whats-this/bitscan/notify"
+	"github.com/whats-this/bitscan/queue"
+	"github.com/whats-this/bitscan/scanner"
+	"github.com/whats-this/bitscan/varnish"
 	"github.com/whats-this/cdn-origin/weed"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
 	"github.com/buaazp/fasthttprouter"
 	"github.com/dchest/uniuri"
-	"github.com/sheenobu/go-clamscan"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
 )
 
 // currentAPIVersion represents the current API base path.
@@ -39,14 +49,6 @@ const applicationJSON = "application/json"
 // contentType is the content type header to read request content type from.
 const contentType = "Content-Type"
 
-// attachment represents a Slack webhook attachment.
-type attachment struct {
-	Fallback string `json:"fallback"`
-	Color    string `json:"color"`
-	Title    string `json:"title"`
-	Text     string `json:"text"`
-}
-
 // object represents a bitbin object.
 type object struct {
 	BucketKey     string  `json:"bucket_key"`
@@ -63,6 +65,23 @@ type object struct {
 	MD5Hash       *string `json:"md5_hash"`
 }
 
+// bulkJob describes a file discovered by a scanBucket filer walk. Unlike
+// object, it has no backend file ID: it's fetched straight from the filer
+// by path instead of from the SeaweedFS master/volume servers.
+type bulkJob struct {
+	BucketKey string `json:"bucket_key"`
+	Path      string `json:"path"`
+	MD5Hash   string `json:"md5_hash"`
+}
+
+// queuedJob is the envelope persisted onto scanQueue. Kind picks which of
+// Object or Bulk the payload was built from; scanJobHandler dispatches on it.
+type queuedJob struct {
+	Kind   string   `json:"kind"`
+	Object *object  `json:"object,omitempty"`
+	Bulk   *bulkJob `json:"bulk,omitempty"`
+}
+
 func init() {
 	// http.listenAddress (string=":8080"): TCP address to listen to for HTTP requests
 	viper.SetDefault("http.listenAddress", ":8080")
@@ -72,15 +91,119 @@ func init() {
 	viper.SetDefault("log.debug", false)
 	viper.BindEnv("log.debug", "DEBUG")
 
-	// notifications.slackWebhookURL (string=""): optional webhook URL for Slack-compatible notification messages
-	// (error + positive files)
+	// notifications.slackWebhookURL (string=""): optional webhook URL for a
+	// Slack-compatible incoming webhook
 	viper.SetDefault("notifications.slackWebhookURL", "")
 	viper.BindEnv("SLACK_WEBHOOK_URL", "notifications.slackWebhookURL")
 
+	// notifications.discordWebhookURL (string=""): optional webhook URL for a Discord
+	// incoming webhook
+	viper.SetDefault("notifications.discordWebhookURL", "")
+
+	// notifications.teamsWebhookURL (string=""): optional webhook URL for a Microsoft
+	// Teams incoming webhook
+	viper.SetDefault("notifications.teamsWebhookURL", "")
+
+	// notifications.pagerduty.routingKey (string=""): PagerDuty Events v2 integration
+	// routing key to page on-call with
+	viper.SetDefault("notifications.pagerduty.routingKey", "")
+
+	// notifications.webhook.url / notifications.webhook.secret (string): optional
+	// generic JSON webhook, signed with an HMAC-SHA256 of notifications.webhook.secret
+	viper.SetDefault("notifications.webhook.url", "")
+	viper.SetDefault("notifications.webhook.secret", "")
+
+	// notifications.sinks.errors / notifications.sinks.positive ([]string=[]):
+	// which configured sinks ("slack", "discord", "teams", "pagerduty", "webhook")
+	// receive scan errors vs. positive hits. Nothing is wired up by default;
+	// operators opt in once they've configured at least one sink's URL/key.
+	viper.SetDefault("notifications.sinks.errors", []string{})
+	viper.SetDefault("notifications.sinks.positive", []string{})
+
 	// seaweed.masterURL* (string): SeaweedFS master URL
 	viper.SetDefault("seaweed.masterURL", "http://localhost:9333")
 	viper.BindEnv("SEAWEED_MASTER_URL", "seaweed.masterURL")
 
+	// scan.pipeline ([]string=["clamd"]): ordered list of scanner backends to run for
+	// each object, stopping at the first positive hit. Valid entries are "clamd",
+	// "icap", "yara" and "virustotal".
+	viper.SetDefault("scan.pipeline", []string{"clamd"})
+
+	// scan.clamd.network / scan.clamd.address (string): when set, clamd is scanned
+	// over its INSTREAM protocol (streaming objects straight from SeaweedFS) instead
+	// of through the bundled clamscan library. network is "unix" or "tcp".
+	viper.SetDefault("scan.clamd.network", "")
+	viper.SetDefault("scan.clamd.address", "/var/run/clamav/clamd.ctl")
+
+	// scan.maxInMemoryBytes (int=26214400): objects no larger than this are streamed
+	// directly into the scan pipeline; larger objects are spooled to a temporary file
+	// first. Only takes effect when scan.pipeline resolves to a single streamable
+	// backend (currently just clamd with scan.clamd.network set).
+	viper.SetDefault("scan.maxInMemoryBytes", 25*1024*1024)
+
+	// scan.icap.address / scan.icap.service (string): ICAP RESPMOD appliance to use
+	// when "icap" is in scan.pipeline
+	viper.SetDefault("scan.icap.address", "")
+	viper.SetDefault("scan.icap.service", "avscan")
+
+	// scan.virustotal.apiKey (string): VirusTotal API key to use when "virustotal"
+	// is in scan.pipeline
+	viper.SetDefault("scan.virustotal.apiKey", "")
+	viper.BindEnv("VIRUSTOTAL_API_KEY", "scan.virustotal.apiKey")
+
+	// queue.dbPath (string): path to the BoltDB file backing the durable scan queue
+	viper.SetDefault("queue.dbPath", "bitscan_queue.db")
+
+	// queue.workers (int=runtime.NumCPU()): size of the bounded worker pool that
+	// drains the scan queue
+	viper.SetDefault("queue.workers", runtime.NumCPU())
+
+	// queue.maxAttempts (int=5): how many times a failing job is retried before it
+	// is moved to the dead-letter list
+	viper.SetDefault("queue.maxAttempts", 5)
+
+	// queue.backoffSeconds (int=2): base delay between retries of a failing job,
+	// doubled with each attempt
+	viper.SetDefault("queue.backoffSeconds", 2)
+
+	// remediation.autoDelete (bool=false): delete positively-scanned objects from
+	// SeaweedFS
+	viper.SetDefault("remediation.autoDelete", false)
+
+	// remediation.purgeCache (bool=false): purge positively-scanned objects from
+	// the configured Varnish nodes
+	viper.SetDefault("remediation.purgeCache", false)
+
+	// remediation.dryRun (bool=true): only report what remediation would have done
+	// in the Slack webhook, without actually deleting or purging anything
+	viper.SetDefault("remediation.dryRun", true)
+
+	// varnish.nodes ([]string=[]): base URLs of the Varnish nodes to purge/ban
+	// against when remediation.purgeCache is enabled
+	viper.SetDefault("varnish.nodes", []string{})
+
+	// scanBucket.filerURL (string): SeaweedFS filer to list and fetch objects
+	// from for POST /v1/scanBucket sweeps
+	viper.SetDefault("scanBucket.filerURL", "http://localhost:8888")
+	viper.BindEnv("SEAWEED_FILER_URL", "scanBucket.filerURL")
+
+	// scanBucket.pageSize (int=100): entries requested per filer listing page
+	viper.SetDefault("scanBucket.pageSize", 100)
+
+	// scanBucket.ratePerSecond (float64=10): maximum rate at which a bucket
+	// sweep enqueues jobs, so it doesn't starve interactive scanObject.async
+	// traffic for worker pool capacity
+	viper.SetDefault("scanBucket.ratePerSecond", 10.0)
+
+	// scanBucket.incremental (bool=true): skip files whose MD5 hash was
+	// already scanned clean, per scanBucket.cacheDbPath
+	viper.SetDefault("scanBucket.incremental", true)
+
+	// scanBucket.cacheDbPath (string): BoltDB file persisting, per bucket
+	// walk, the last listing cursor (for resuming) and the set of MD5 hashes
+	// already scanned clean (for incremental mode)
+	viper.SetDefault("scanBucket.cacheDbPath", "bitscan_bucket_cache.db")
+
 	// Configuration file settings
 	viper.SetConfigType("toml")
 	viper.SetConfigName("bitscan")
@@ -99,17 +222,113 @@ func init() {
 	}
 }
 
-// httpClient to use for webhook requests.
-var httpClient = &http.Client{
-	Jar:     nil,
-	Timeout: time.Minute * 5,
-}
-
 // seaweed client to use for fetching files from the SeaweedFS cluster.
 var seaweed *weed.Seaweed
 
-// tmpDir is the directory used for storing downloaded files before they are scanned.
-var tmpDir string
+// pipeline is the ordered set of scanner backends every object is run through.
+var pipeline *scanner.Pipeline
+
+// notifyRouter fans scan outcomes out to the configured notification sinks.
+var notifyRouter *notify.Router
+
+// scanQueue is the bounded worker pool and durable job list scanObject.async
+// enqueues onto.
+var scanQueue *queue.Queue
+
+// varnishClient purges positively-scanned objects from cache, when configured.
+var varnishClient *varnish.Client
+
+// filerClient lists and fetches files for POST /v1/scanBucket sweeps.
+var filerClient *filer.Client
+
+// bucketCacheDB persists scanBucket walk cursors (for resuming) and
+// known-clean MD5 hashes (for incremental mode).
+var bucketCacheDB *bolt.DB
+
+var (
+	bucketWalkCursors = []byte("cursors")
+	bucketCleanHashes = []byte("clean-hashes")
+)
+
+// newPipeline builds the scanner pipeline described by the scan.pipeline config key.
+func newPipeline() (*scanner.Pipeline, error) {
+	var backends []scanner.Backend
+
+	for _, name := range viper.GetStringSlice("scan.pipeline") {
+		switch name {
+		case "clamd":
+			backends = append(backends, &scanner.Clamd{
+				Network: viper.GetString("scan.clamd.network"),
+				Address: viper.GetString("scan.clamd.address"),
+				Timeout: time.Second * 30,
+			})
+		case "icap":
+			backends = append(backends, &scanner.ICAP{
+				Address: viper.GetString("scan.icap.address"),
+				Service: viper.GetString("scan.icap.service"),
+				Timeout: time.Second * 30,
+			})
+		case "virustotal":
+			backends = append(backends, scanner.NewVirusTotal(viper.GetString("scan.virustotal.apiKey")))
+		case "yara":
+			return nil, errors.New("scan.pipeline: \"yara\" requires a binary built with YARA support")
+		default:
+			return nil, errors.New("unknown scan.pipeline backend: " + name)
+		}
+	}
+
+	return scanner.NewPipeline(backends...), nil
+}
+
+// newNotifyRouter builds the notification sink for each configured name and
+// wires it up to receive the severities listed for it in
+// notifications.sinks.errors / notifications.sinks.positive.
+func newNotifyRouter() (*notify.Router, error) {
+	router := notify.NewRouter()
+
+	sinksByName := map[string]notify.Sink{}
+	newSink := func(name string) (notify.Sink, error) {
+		switch name {
+		case "slack":
+			return notify.NewSlack(viper.GetString("notifications.slackWebhookURL")), nil
+		case "discord":
+			return notify.NewDiscord(viper.GetString("notifications.discordWebhookURL")), nil
+		case "teams":
+			return notify.NewTeams(viper.GetString("notifications.teamsWebhookURL")), nil
+		case "pagerduty":
+			return notify.NewPagerDuty(viper.GetString("notifications.pagerduty.routingKey")), nil
+		case "webhook":
+			return notify.NewWebhook(
+				viper.GetString("notifications.webhook.url"),
+				viper.GetString("notifications.webhook.secret"),
+			), nil
+		default:
+			return nil, errors.New("unknown notification sink: " + name)
+		}
+	}
+
+	severities := map[notify.Severity]string{
+		notify.SeverityError:    "notifications.sinks.errors",
+		notify.SeverityPositive: "notifications.sinks.positive",
+	}
+
+	for severity, configKey := range severities {
+		for _, name := range viper.GetStringSlice(configKey) {
+			sink, ok := sinksByName[name]
+			if !ok {
+				var err error
+				sink, err = newSink(name)
+				if err != nil {
+					return nil, err
+				}
+				sinksByName[name] = sink
+			}
+			router.Add(severity, sink)
+		}
+	}
+
+	return router, nil
+}
 
 func main() {
 	var err error
@@ -122,6 +341,67 @@ func main() {
 		return
 	}
 
+	// Build the scanner backend pipeline
+	pipeline, err = newPipeline()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to configure scan pipeline")
+		return
+	}
+
+	// Open the durable scan queue and start its worker pool
+	scanQueue, err = queue.Open(viper.GetString("queue.dbPath"), scanJobHandler, queue.Options{
+		Workers:     viper.GetInt("queue.workers"),
+		MaxAttempts: viper.GetInt("queue.maxAttempts"),
+		Backoff:     time.Duration(viper.GetInt("queue.backoffSeconds")) * time.Second,
+		OnPersistError: func(err error) {
+			log.WithField("err", err).Error("failed to persist scan queue state")
+		},
+	})
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to open scan queue")
+		return
+	}
+	defer scanQueue.Close()
+
+	// Configure the Varnish client, if any nodes were supplied
+	if nodes := viper.GetStringSlice("varnish.nodes"); len(nodes) > 0 {
+		varnishClient = varnish.New(nodes)
+	}
+
+	// Build the filer client and open the bucket walk cache for scanBucket
+	filerClient = filer.New(viper.GetString("scanBucket.filerURL"))
+	bucketCacheDB, err = bolt.Open(viper.GetString("scanBucket.cacheDbPath"), 0660, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to open bucket walk cache")
+		return
+	}
+	defer bucketCacheDB.Close()
+	err = bucketCacheDB.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketWalkCursors); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketCleanHashes)
+		return err
+	})
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to initialize bucket walk cache")
+		return
+	}
+
+	// Build the notification sinks and expose the scan queue depth to Prometheus
+	notifyRouter, err = newNotifyRouter()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to configure notification sinks")
+		return
+	}
+	metrics.RegisterQueueDepth(func() float64 {
+		status, err := scanQueue.Status()
+		if err != nil {
+			return -1
+		}
+		return float64(status.QueueDepth)
+	})
+
 	// Create router
 	router := &fasthttprouter.Router{
 		RedirectTrailingSlash:  true,
@@ -149,6 +429,9 @@ func main() {
 
 	// Apply routes
 
+	// > GET /metrics (Prometheus metrics)
+	router.GET("/metrics", fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler()))
+
 	// > GET / (index)
 	router.GET("/", func(ctx *fasthttp.RequestCtx) {
 		ctx.SetStatusCode(fasthttp.StatusOK)
@@ -159,9 +442,11 @@ func main() {
 
 	// > POST /scanObject.async (scanObject.async)
 	// Scan a file, expects a file object to be supplied.
-	// Scans are run asynchronously on this route, and 201 Accepted responses are returned immediately.
-	// If a virus is detected, a Slack webhook is fired.
-	// TODO: automatically delete files and clear Varnish cache (?)
+	// Scans are queued onto the bounded worker pool, and 202 Accepted responses
+	// (with a job ID the client can poll via scanObject.async/status) are
+	// returned immediately. If a virus is detected, the configured notification
+	// sinks fire and remediation (deletion + cache purge) runs as configured
+	// under remediation.*.
 	router.POST("/v1/scanObject.async", func(ctx *fasthttp.RequestCtx) {
 		ctx.SetContentType("application/json; charset=utf-8")
 
@@ -188,10 +473,84 @@ func main() {
 			return
 		}
 
-		// Scan asynchronously and return response
-		go processScan(data)
+		// Persist the job and hand it to the worker pool
+		payload, err := json.Marshal(queuedJob{Kind: "object", Object: data})
+		if err != nil {
+			log.WithField("err", err).Error("failed to marshal scan job")
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			fmt.Fprint(ctx, `{"code":500,"message":"Internal Server Error (failed to enqueue job)"}`)
+			return
+		}
+		jobID, err := scanQueue.Enqueue(payload)
+		if err != nil {
+			log.WithField("err", err).Error("failed to enqueue scan job")
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			fmt.Fprint(ctx, `{"code":500,"message":"Internal Server Error (failed to enqueue job)"}`)
+			return
+		}
+
 		ctx.SetStatusCode(fasthttp.StatusAccepted)
-		fmt.Fprint(ctx, `{"code":201,"message":"Accepted (processing asynchronously)"}`)
+		fmt.Fprintf(ctx, `{"code":202,"message":"Accepted (processing asynchronously)","job_id":"%s"}`, jobID)
+	})
+
+	// > POST /scanBucket (scanBucket)
+	// Walks every file under a SeaweedFS filer bucket/prefix and enqueues it
+	// for scanning through the same worker pool as scanObject.async. The
+	// walk runs in the background; this only kicks it off.
+	router.POST("/v1/scanBucket", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("application/json; charset=utf-8")
+
+		if !strings.HasPrefix(string(ctx.Request.Header.Peek(contentType)), applicationJSON) {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			fmt.Fprint(ctx, `{"code":400,"message":"Bad Request (Content-Type not JSON)"}`)
+			return
+		}
+
+		req := &struct {
+			Bucket string `json:"bucket"`
+			Prefix string `json:"prefix"`
+		}{}
+		if err := json.Unmarshal(ctx.PostBody(), req); err != nil {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			fmt.Fprint(ctx, `{"code":400,"message":"Bad Request (could not parse JSON body)"}`)
+			return
+		}
+		if req.Bucket == "" {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			fmt.Fprint(ctx, `{"code":400,"message":"Bad Request (bucket is required)"}`)
+			return
+		}
+
+		go walkBucket(req.Bucket, req.Prefix)
+
+		ctx.SetStatusCode(fasthttp.StatusAccepted)
+		fmt.Fprint(ctx, `{"code":202,"message":"Accepted (sweep started)"}`)
+	})
+
+	// > GET /scanObject.async/status (scanObject.async/status)
+	// Reports the durable scan queue's depth, in-flight job count, and the
+	// most recent permanently-failed (dead-lettered) jobs.
+	router.GET("/v1/scanObject.async/status", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("application/json; charset=utf-8")
+
+		status, err := scanQueue.Status()
+		if err != nil {
+			log.WithField("err", err).Error("failed to read scan queue status")
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			fmt.Fprint(ctx, `{"code":500,"message":"Internal Server Error"}`)
+			return
+		}
+
+		d, err := json.Marshal(status)
+		if err != nil {
+			log.WithField("err", err).Error("failed to marshal scan queue status")
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			fmt.Fprint(ctx, `{"code":500,"message":"Internal Server Error"}`)
+			return
+		}
+
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.Write(d)
 	})
 
 	// Serve
@@ -210,105 +569,246 @@ func main() {
 	}
 }
 
-// getTempFilename returns a filename with the supplied extension (ext should have period).
-func getTempFilename(ext string) (string, error) {
-	if tmpDir == "" {
-		tmpDir = os.TempDir() + "/bitscan_" + uniuri.New()
+// newTempFile creates a fresh temporary directory and returns a path within
+// it with the supplied extension (ext should have a leading period). Each
+// call gets its own directory, so concurrent processScan goroutines never
+// race over a shared one; the caller is responsible for cleaning it up.
+func newTempFile(ext string) (string, error) {
+	dir, err := ioutil.TempDir("", "bitscan_")
+	if err != nil {
+		log.WithField("err", err).Error("failed to create temporary directory")
+		return "", err
 	}
-
-	// Check if directory exists, otherwise create new directory
-	info, err := os.Stat(tmpDir)
-	if err != nil || !info.IsDir() {
-		tmpDir = os.TempDir() + "/bitscan_" + uniuri.New()
-		err = os.Mkdir(tmpDir, folderFileMode)
-		if err != nil {
-			log.WithField("err", err).Error("failed to generate temporary directory")
-			return "", err
-		}
+	if err := os.Chmod(dir, folderFileMode); err != nil {
+		log.WithField("err", err).Error("failed to set temporary directory permissions")
+		return "", err
 	}
 
-	return tmpDir + "/" + uniuri.New() + ext, nil
+	return dir + "/" + uniuri.New() + ext, nil
 }
 
-// sendWebhook to the Slack endpoint in the configuration.
-func sendWebhook(title, text, color string) error {
-	if viper.GetString("notifications.slackWebhookURL") == "" {
-		return nil
+// scanJobHandler decodes a queued job's payload and routes it to the scan
+// it was built from; it's the queue.Handler the worker pool calls for every
+// job, regardless of whether it came from scanObject.async or a scanBucket
+// sweep.
+func scanJobHandler(payload []byte) error {
+	job := &queuedJob{}
+	if err := json.Unmarshal(payload, job); err != nil {
+		return errors.New("failed to parse queued job: " + err.Error())
 	}
 
-	d, err := json.Marshal(map[string][]attachment{
-		"attachments": {
-			{
-				Fallback: fmt.Sprintf("**%s**\n%s", title, text),
-				Color:    color,
-				Title:    title,
-				Text:     text,
-			},
-		},
-	})
-	if err != nil {
-		return err
+	if job.Kind == "bulk" {
+		return processBulkScan(job.Bulk)
 	}
-
-	_, err = httpClient.Post(viper.GetString("notifications.slackWebhookURL"), applicationJSON, bytes.NewBuffer(d))
-	return err
+	return processScan(job.Object)
 }
 
 func processScan(object *object) error {
 	res, err := scan(object)
-	if err != nil {
-		err = sendWebhook(
-			fmt.Sprintf("Error scanning `%s`", object.BucketKey),
-			fmt.Sprintf("```\n%s```", err),
-			"danger")
-		if err != nil {
-			log.WithField("err", err).Error("failed to invoke webhook")
+	return reportScanResult(object, res, err)
+}
+
+// processBulkScan fetches a scanBucket-discovered file straight from the
+// filer and scans it, then records a clean verdict in the incremental cache
+// so future sweeps can skip it.
+func processBulkScan(job *bulkJob) error {
+	res, err := scanFilerEntry(job.Path, job.MD5Hash)
+
+	obj := &object{BucketKey: job.BucketKey, Key: path.Base(job.Path)}
+	if job.MD5Hash != "" {
+		obj.MD5Hash = &job.MD5Hash
+	}
+
+	reportErr := reportScanResult(obj, res, err)
+
+	if err == nil && !res.Found && job.MD5Hash != "" {
+		if err := markClean(job.MD5Hash); err != nil {
+			log.WithField("err", err).Error("failed to record clean verdict in bucket walk cache")
 		}
-		return err
 	}
-	if res.Error != nil {
-		err = sendWebhook(
-			fmt.Sprintf("Error scanning `%s`", object.BucketKey),
-			fmt.Sprintf("```\n%s```", res.Error),
-			"danger")
-		if err != nil {
-			log.WithField("err", err).Error("failed to invoke webhook")
+
+	return reportErr
+}
+
+// reportScanResult records metrics, logs and notifications for a completed
+// scan attempt, and triggers remediation on a positive hit. It's shared by
+// scanObject.async and scanBucket, which differ only in how they fetch the
+// file to scan. Only a failure to perform the scan itself is returned: once
+// a scan has completed (clean or positive), a notification delivery
+// failure is logged but doesn't fail the caller, since the underlying job
+// is done and retrying it wouldn't help deliver the notification.
+func reportScanResult(object *object, res *scanner.Result, err error) error {
+	if err != nil {
+		metrics.ScansTotal.WithLabelValues("error", "").Inc()
+
+		notifyErr := notifyRouter.Notify(notify.Notification{
+			Severity:  notify.SeverityError,
+			Title:     fmt.Sprintf("Error scanning `%s`", object.BucketKey),
+			Text:      fmt.Sprintf("```\n%s```", err),
+			BucketKey: object.BucketKey,
+		})
+		if notifyErr != nil {
+			log.WithField("err", notifyErr).Error("failed to deliver notification")
 		}
 		return err
 	}
 
+	verdict := "clean"
+	if res.Found {
+		verdict = "positive"
+	}
+	metrics.ScansTotal.WithLabelValues(verdict, res.Engine).Inc()
+	metrics.ScanDuration.WithLabelValues(res.Engine).Observe(res.Elapsed.Seconds())
+
 	if res.Found {
+		md5Hash := ""
+		if object.MD5Hash != nil {
+			md5Hash = *object.MD5Hash
+		}
+
 		log.WithFields(log.Fields{
 			"bucket_key": object.BucketKey,
+			"engine":     res.Engine,
 			"virus":      res.Virus,
-			"md5_hash":   object.MD5Hash,
+			"md5_hash":   md5Hash,
+			"elapsed":    res.Elapsed,
 		}).Info("found virus in a file")
-		err = sendWebhook(fmt.Sprintf("Positive file found: `%s`", object.BucketKey),
-			fmt.Sprintf("`%s` (`%s`) returned positive during scan with virus `%s`.\n\n"+
-				"It has not been deleted from storage backend.", object.BucketKey, object.MD5Hash,
-				res.Virus),
-			"#439FE0")
-		if err != nil {
-			log.WithField("err", err).Error("failed to invoke webhook")
+
+		remediationSummary := remediate(object)
+
+		notifyErr := notifyRouter.Notify(notify.Notification{
+			Severity: notify.SeverityPositive,
+			Title:    fmt.Sprintf("Positive file found: `%s`", object.BucketKey),
+			Text: fmt.Sprintf("`%s` (`%s`) returned positive during scan with virus `%s`.\n\n"+
+				"Detected by `%s` in %s.\n\n%s", object.BucketKey, md5Hash,
+				res.Virus, res.Engine, res.Elapsed, remediationSummary),
+			BucketKey: object.BucketKey,
+			MD5Hash:   md5Hash,
+			Engine:    res.Engine,
+			Virus:     res.Virus,
+		})
+		if notifyErr != nil {
+			// The scan itself succeeded and remediation already ran; a
+			// failure to deliver the notification shouldn't make the queue
+			// retry (and eventually dead-letter) an otherwise-completed job.
+			log.WithField("err", notifyErr).Error("failed to deliver notification")
 		}
-		return err
+		return nil
 	}
 
 	return nil
 }
 
-func scan(object *object) (*clamscan.Result, error) {
-	path, err := getTempFilename(path.Ext(object.Key))
+// seaweedDeleter is implemented by a SeaweedFS client that can delete an
+// object by its backend file ID. It's checked via a type assertion on
+// seaweed rather than called directly, since github.com/whats-this/cdn-origin/weed
+// does not vendor a Delete method yet; remediation.autoDelete degrades to
+// reporting the gap instead of failing to build once that method lands.
+type seaweedDeleter interface {
+	Delete(fileID string) error
+}
+
+// remediate deletes a positively-scanned object from SeaweedFS and purges it
+// from Varnish, as enabled by remediation.autoDelete / remediation.purgeCache,
+// and returns a human-readable summary of what happened (or would have
+// happened, in dry-run mode) for inclusion in the Slack notification.
+func remediate(object *object) string {
+	dryRun := viper.GetBool("remediation.dryRun")
+	var lines []string
+
+	if viper.GetBool("remediation.autoDelete") {
+		deleter, canDelete := interface{}(seaweed).(seaweedDeleter)
+
+		switch {
+		case dryRun:
+			lines = append(lines, "Would have deleted the object from SeaweedFS (dry run).")
+		case object.BackendFileID == nil:
+			lines = append(lines, "Could not delete from SeaweedFS: object has no backend file ID.")
+		case !canDelete:
+			lines = append(lines, "Could not delete from SeaweedFS: the installed weed client does not support Delete yet.")
+		default:
+			if err := deleter.Delete(*object.BackendFileID); err != nil {
+				log.WithField("err", err).Error("failed to delete object from SeaweedFS")
+				lines = append(lines, "Failed to delete the object from SeaweedFS: "+err.Error())
+			} else {
+				lines = append(lines, "Deleted the object from SeaweedFS.")
+			}
+		}
+	}
+
+	if viper.GetBool("remediation.purgeCache") {
+		switch {
+		case dryRun:
+			lines = append(lines, "Would have purged the object from Varnish (dry run).")
+		case varnishClient == nil:
+			lines = append(lines, "Could not purge from Varnish: no nodes configured.")
+		default:
+			if err := varnishClient.Ban("X-Bucket-Key", object.BucketKey); err != nil {
+				log.WithField("err", err).Error("failed to purge object from Varnish")
+				lines = append(lines, "Failed to purge the object from Varnish: "+err.Error())
+			} else {
+				lines = append(lines, "Purged the object from Varnish.")
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return "It has not been deleted from storage backend or purged from cache."
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func scan(object *object) (*scanner.Result, error) {
+	underThreshold := object.ContentLength != nil &&
+		int64(*object.ContentLength) <= viper.GetInt64("scan.maxInMemoryBytes")
+
+	if underThreshold && pipeline.Streamable() {
+		return scanStreamed(object)
+	}
+
+	return scanSpooled(object)
+}
+
+// scanStreamed pipes the object straight from SeaweedFS into the scan
+// pipeline through an io.Pipe, without ever writing it to disk. Callers
+// must check pipeline.Streamable() first: io.Pipe's Write is a synchronous
+// rendezvous with a reader, so starting the SeaweedFS fetch goroutine below
+// against a pipeline that will never read from pr would block that
+// goroutine (and leak its SeaweedFS connection) forever.
+func scanStreamed(object *object) (*scanner.Result, error) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		_, err := seaweed.Get(pw, *object.BackendFileID, "")
+		pw.CloseWithError(err)
+	}()
+
+	res, err := pipeline.ScanStream(pr)
+	if err != nil {
+		log.WithField("err", err).Error("failed to stream-scan file")
+		return nil, errors.New("failed to stream-scan file: " + err.Error())
+	}
+
+	return res, nil
+}
+
+// scanSpooled downloads the object to a per-request temporary file and
+// scans it from disk. Used for objects over scan.maxInMemoryBytes, and as
+// the fallback for pipelines that can't be satisfied from a single stream.
+func scanSpooled(object *object) (*scanner.Result, error) {
+	tmpPath, err := newTempFile(path.Ext(object.Key))
 	if err != nil {
 		return nil, err
 	}
+	defer os.RemoveAll(filepath.Dir(tmpPath))
 
 	// Create temporary file
-	file, err := os.Create(path)
+	file, err := os.Create(tmpPath)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":  err,
-			"path": path,
+			"path": tmpPath,
 		}).Error("failed to create temporary file")
 		return nil, errors.New("failed to create temporary file: " + err.Error())
 	}
@@ -316,22 +816,183 @@ func scan(object *object) (*clamscan.Result, error) {
 
 	// Get file from SeaweedFS
 	_, err = seaweed.Get(file, *object.BackendFileID, "")
+	file.Close()
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":  err,
-			"path": path,
+			"path": tmpPath,
 		}).Error("failed to get file from SeaweedFS backend")
 		return nil, errors.New("failed to get file from SeaweedFS backend: " + err.Error())
 	}
 
-	res, err := clamscan.Scan(&clamscan.Options{}, path)
+	md5Hash := ""
+	if object.MD5Hash != nil {
+		md5Hash = *object.MD5Hash
+	}
+
+	res, err := pipeline.ScanWithHash(tmpPath, md5Hash)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":  err,
-			"path": path,
+			"path": tmpPath,
 		}).Error("failed to scan file")
 		return nil, errors.New("failed to scan file: " + err.Error())
 	}
 
-	return <-res, nil
+	return res, nil
+}
+
+// scanFilerEntry downloads a scanBucket-discovered file from the filer to a
+// per-request temporary file and scans it from disk, the same way
+// scanSpooled does for SeaweedFS-backed objects.
+func scanFilerEntry(filerPath, md5Hash string) (*scanner.Result, error) {
+	tmpPath, err := newTempFile(path.Ext(filerPath))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(filepath.Dir(tmpPath))
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"path": tmpPath,
+		}).Error("failed to create temporary file")
+		return nil, errors.New("failed to create temporary file: " + err.Error())
+	}
+	file.Chmod(objectFileMode)
+
+	err = filerClient.Get(filerPath, file)
+	file.Close()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"path": filerPath,
+		}).Error("failed to get file from filer")
+		return nil, errors.New("failed to get file from filer: " + err.Error())
+	}
+
+	res, err := pipeline.ScanWithHash(tmpPath, md5Hash)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"path": tmpPath,
+		}).Error("failed to scan file")
+		return nil, errors.New("failed to scan file: " + err.Error())
+	}
+
+	return res, nil
+}
+
+// walkBucket lists every file under bucket/prefix from the filer, page by
+// page, enqueuing each one (skipping already-clean ones in incremental mode)
+// through scanQueue at no more than scanBucket.ratePerSecond, so a sweep
+// doesn't starve interactive scanObject.async traffic for worker capacity.
+// The last page cursor is persisted after every page, so a crashed or
+// restarted sweep resumes where it left off instead of rescanning from the
+// start.
+func walkBucket(bucket, prefix string) {
+	walkKey := bucket + "|" + prefix
+	dirPath := "/" + strings.Trim(path.Join(bucket, prefix), "/")
+	pageSize := viper.GetInt("scanBucket.pageSize")
+	incremental := viper.GetBool("scanBucket.incremental")
+
+	rate := viper.GetFloat64("scanBucket.ratePerSecond")
+	if rate <= 0 {
+		rate = 10
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+
+	cursor, err := loadCursor(walkKey)
+	if err != nil {
+		log.WithField("err", err).Error("failed to load bucket walk cursor")
+		return
+	}
+
+	for {
+		entries, next, err := filerClient.Page(dirPath, cursor, pageSize)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":    err,
+				"bucket": bucket,
+				"prefix": prefix,
+			}).Error("failed to list bucket from filer")
+			return
+		}
+
+		for _, entry := range entries {
+			md5Hash := filer.DecodeMD5(entry.Md5)
+			if incremental && md5Hash != "" && isKnownClean(md5Hash) {
+				continue
+			}
+
+			payload, err := json.Marshal(queuedJob{Kind: "bulk", Bulk: &bulkJob{
+				BucketKey: strings.TrimPrefix(entry.FullPath, "/"),
+				Path:      entry.FullPath,
+				MD5Hash:   md5Hash,
+			}})
+			if err != nil {
+				log.WithField("err", err).Error("failed to marshal bulk scan job")
+				continue
+			}
+			if _, err := scanQueue.Enqueue(payload); err != nil {
+				log.WithField("err", err).Error("failed to enqueue bulk scan job")
+			}
+
+			time.Sleep(interval)
+		}
+
+		cursor = next
+		if err := saveCursor(walkKey, cursor); err != nil {
+			log.WithField("err", err).Error("failed to persist bucket walk cursor")
+		}
+
+		if cursor == "" {
+			return
+		}
+	}
+}
+
+// loadCursor returns the last persisted filer listing cursor for walkKey, or
+// "" if the walk has never run (or has completed and is starting over).
+func loadCursor(walkKey string) (string, error) {
+	var cursor string
+	err := bucketCacheDB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketWalkCursors).Get([]byte(walkKey)); v != nil {
+			cursor = string(v)
+		}
+		return nil
+	})
+	return cursor, err
+}
+
+// saveCursor persists the next filer listing cursor for walkKey, clearing it
+// once the walk reaches the end so the next sweep starts from the top.
+func saveCursor(walkKey, cursor string) error {
+	return bucketCacheDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketWalkCursors)
+		if cursor == "" {
+			return b.Delete([]byte(walkKey))
+		}
+		return b.Put([]byte(walkKey), []byte(cursor))
+	})
+}
+
+// isKnownClean reports whether md5Hash was already scanned with a clean
+// verdict by a previous sweep.
+func isKnownClean(md5Hash string) bool {
+	var known bool
+	bucketCacheDB.View(func(tx *bolt.Tx) error {
+		known = tx.Bucket(bucketCleanHashes).Get([]byte(md5Hash)) != nil
+		return nil
+	})
+	return known
+}
+
+// markClean records md5Hash as having scanned clean, so incremental sweeps
+// can skip it in the future.
+func markClean(md5Hash string) error {
+	return bucketCacheDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCleanHashes).Put([]byte(md5Hash), []byte{1})
+	})
 }
@@ -0,0 +1,113 @@
+// Package filer talks to a SeaweedFS filer's directory-listing HTTP API, so
+// bitscan can walk every object under a bucket/prefix for a bulk scan.
+package filer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Entry is a single file returned by a directory listing.
+type Entry struct {
+	FullPath string `json:"FullPath"`
+	FileSize int64  `json:"FileSize"`
+	Md5      string `json:"Md5"`
+}
+
+// listing is the subset of the filer's JSON directory listing response
+// bitscan uses. LastFileName doubles as the cursor for the next page.
+type listing struct {
+	Entries               []Entry `json:"Entries"`
+	LastFileName          string  `json:"LastFileName"`
+	ShouldDisplayLoadMore bool    `json:"ShouldDisplayLoadMore"`
+}
+
+// Client lists and fetches files from a SeaweedFS filer over its HTTP API.
+type Client struct {
+	FilerURL   string
+	HTTPClient *http.Client
+}
+
+// New returns a Client talking to the filer at filerURL (e.g.
+// "http://localhost:8888").
+func New(filerURL string) *Client {
+	return &Client{FilerURL: filerURL, HTTPClient: &http.Client{Timeout: time.Second * 30}}
+}
+
+// Page lists up to limit entries under dirPath, resuming after cursor (the
+// previous page's LastFileName, or "" for the first page). nextCursor is ""
+// once the listing is exhausted.
+func (c *Client) Page(dirPath, cursor string, limit int) (entries []Entry, nextCursor string, err error) {
+	u := c.FilerURL + dirPath
+	q := url.Values{}
+	q.Set("pretty", "y")
+	q.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		q.Set("lastFileName", cursor)
+	}
+
+	req, err := http.NewRequest("GET", u+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.New("filer: unexpected status listing " + dirPath + ": " + resp.Status)
+	}
+
+	var l listing
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, "", errors.New("filer: failed to decode listing: " + err.Error())
+	}
+
+	if l.ShouldDisplayLoadMore {
+		nextCursor = l.LastFileName
+	}
+
+	return l.Entries, nextCursor, nil
+}
+
+// Get downloads the file at filePath from the filer, writing its contents
+// to w.
+func (c *Client) Get(filePath string, w io.Writer) error {
+	resp, err := c.HTTPClient.Get(c.FilerURL + filePath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("filer: unexpected status fetching " + filePath + ": " + resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DecodeMD5 converts a filer entry's base64-encoded Md5 field into the hex
+// string bitscan uses elsewhere (object.MD5Hash). It returns "" if md5 is
+// empty or malformed.
+func DecodeMD5(md5 string) string {
+	if md5 == "" {
+		return ""
+	}
+	raw, err := base64.StdEncoding.DecodeString(md5)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
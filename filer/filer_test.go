@@ -0,0 +1,82 @@
+package filer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPageReturnsCursorWhenMoreAvailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("lastFileName"); got != "b.txt" {
+			t.Errorf("expected lastFileName=b.txt, got %q", got)
+		}
+		if got := r.URL.Query().Get("limit"); got != "1" {
+			t.Errorf("expected limit=1, got %q", got)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Entries":               []Entry{{FullPath: "/bucket/c.txt"}},
+			"LastFileName":          "c.txt",
+			"ShouldDisplayLoadMore": true,
+		})
+	}))
+	defer server.Close()
+
+	entries, next, err := New(server.URL).Page("/bucket", "b.txt", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].FullPath != "/bucket/c.txt" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if next != "c.txt" {
+		t.Fatalf("expected next cursor %q, got %q", "c.txt", next)
+	}
+}
+
+func TestPageReturnsEmptyCursorWhenExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Entries":               []Entry{},
+			"LastFileName":          "z.txt",
+			"ShouldDisplayLoadMore": false,
+		})
+	}))
+	defer server.Close()
+
+	_, next, err := New(server.URL).Page("/bucket", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "" {
+		t.Fatalf("expected an empty cursor once exhausted, got %q", next)
+	}
+}
+
+func TestPageReturnsErrorOnNonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, _, err := New(server.URL).Page("/missing", "", 10); err == nil {
+		t.Fatal("expected an error for a non-200 response")
+	}
+}
+
+func TestDecodeMD5(t *testing.T) {
+	const b64 = "80Dw0t9VJ1n0nZtq+diovA=="
+	const wantHex = "f340f0d2df552759f49d9b6af9d8a8bc"
+
+	if got := DecodeMD5(b64); got != wantHex {
+		t.Fatalf("got %q, want %q", got, wantHex)
+	}
+	if got := DecodeMD5(""); got != "" {
+		t.Fatalf("expected empty string for empty input, got %q", got)
+	}
+	if got := DecodeMD5("not valid base64!!"); got != "" {
+		t.Fatalf("expected empty string for malformed input, got %q", got)
+	}
+}
@@ -0,0 +1,33 @@
+// Package metrics holds the Prometheus collectors bitscan exposes on
+// /metrics, so operators can alert on scan verdicts, scan duration and
+// scan queue backlog.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ScansTotal counts completed scans by verdict ("clean", "positive" or
+// "error") and engine.
+var ScansTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "bitscan_scans_total",
+	Help: "Total number of scans performed, by verdict and engine.",
+}, []string{"verdict", "engine"})
+
+// ScanDuration observes how long each engine took to produce a result.
+var ScanDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bitscan_scan_duration_seconds",
+	Help:    "Time taken to scan an object, by engine.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"engine"})
+
+func init() {
+	prometheus.MustRegister(ScansTotal, ScanDuration)
+}
+
+// RegisterQueueDepth exposes depth as the bitscan_queue_depth gauge,
+// sampling it fresh on every /metrics scrape.
+func RegisterQueueDepth(depth func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "bitscan_queue_depth",
+		Help: "Current number of jobs waiting in the scan queue.",
+	}, depth))
+}
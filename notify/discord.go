@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+}
+
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// Discord delivers notifications to a Discord incoming webhook as an embed.
+type Discord struct {
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+// NewDiscord returns a Discord sink posting to webhookURL.
+func NewDiscord(webhookURL string) *Discord {
+	return &Discord{WebhookURL: webhookURL, HTTPClient: &http.Client{Timeout: time.Minute}}
+}
+
+// Name implements Sink.
+func (d *Discord) Name() string { return "discord" }
+
+// Notify implements Sink.
+func (d *Discord) Notify(n Notification) error {
+	if d.WebhookURL == "" {
+		return nil
+	}
+
+	color := 0x439FE0
+	if n.Severity == SeverityError {
+		color = 0xFF0000
+	}
+
+	body, err := json.Marshal(discordPayload{Embeds: []discordEmbed{{
+		Title:       n.Title,
+		Description: n.Text,
+		Color:       color,
+	}}})
+	if err != nil {
+		return err
+	}
+
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(d.WebhookURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("discord: unexpected status " + resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package notify defines pluggable notification sinks bitscan can report
+// scan outcomes to (Slack, Discord, Teams, PagerDuty, or a generic signed
+// webhook), and a Router that fans a notification out to the sinks
+// configured for its severity.
+package notify
+
+import "errors"
+
+// Severity classifies a Notification for routing to the right sinks.
+type Severity string
+
+const (
+	// SeverityError is used when a scan itself failed to complete.
+	SeverityError Severity = "error"
+
+	// SeverityPositive is used when a scan completed and found something.
+	SeverityPositive Severity = "positive"
+)
+
+// Notification describes a single scan outcome to report.
+type Notification struct {
+	Severity  Severity
+	Title     string
+	Text      string
+	BucketKey string
+	MD5Hash   string
+	Engine    string
+	Virus     string
+}
+
+// Sink delivers a Notification somewhere.
+type Sink interface {
+	// Name identifies the sink in error messages.
+	Name() string
+
+	// Notify delivers n, returning any delivery error.
+	Notify(n Notification) error
+}
+
+// Router fans a Notification out to every sink registered for its severity.
+type Router struct {
+	bySeverity map[Severity][]Sink
+}
+
+// NewRouter returns an empty Router; use Add to register sinks.
+func NewRouter() *Router {
+	return &Router{bySeverity: make(map[Severity][]Sink)}
+}
+
+// Add registers sinks to receive notifications of the given severity.
+func (r *Router) Add(severity Severity, sinks ...Sink) {
+	r.bySeverity[severity] = append(r.bySeverity[severity], sinks...)
+}
+
+// Notify delivers n to every sink registered for n.Severity, returning the
+// first error encountered after still attempting the remaining sinks.
+func (r *Router) Notify(n Notification) error {
+	var firstErr error
+	for _, sink := range r.bySeverity[n.Severity] {
+		if err := sink.Notify(n); err != nil && firstErr == nil {
+			firstErr = errors.New(sink.Name() + ": " + err.Error())
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+type pagerDutyPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+// PagerDuty pages on-call via the Events v2 API. Alerts for the same object
+// are deduplicated using its MD5 hash as the dedup key, so repeat hits on
+// an already-paged file don't create a new incident.
+type PagerDuty struct {
+	RoutingKey string
+	HTTPClient *http.Client
+}
+
+// NewPagerDuty returns a PagerDuty sink using the given integration routing key.
+func NewPagerDuty(routingKey string) *PagerDuty {
+	return &PagerDuty{RoutingKey: routingKey, HTTPClient: &http.Client{Timeout: time.Second * 10}}
+}
+
+// Name implements Sink.
+func (p *PagerDuty) Name() string { return "pagerduty" }
+
+// Notify implements Sink.
+func (p *PagerDuty) Notify(n Notification) error {
+	if p.RoutingKey == "" {
+		return nil
+	}
+
+	severity := "warning"
+	if n.Severity == SeverityError {
+		severity = "error"
+	}
+
+	body, err := json.Marshal(pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    n.MD5Hash,
+		Payload: pagerDutyPayload{
+			Summary:  n.Title,
+			Source:   "bitscan",
+			Severity: severity,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(pagerDutyEventsURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("pagerduty: unexpected status " + resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// slackAttachment mirrors the Slack incoming-webhook attachment format.
+type slackAttachment struct {
+	Fallback string `json:"fallback"`
+	Color    string `json:"color"`
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+}
+
+// Slack delivers notifications to a Slack-compatible incoming webhook.
+type Slack struct {
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+// NewSlack returns a Slack sink posting to webhookURL.
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{WebhookURL: webhookURL, HTTPClient: &http.Client{Timeout: time.Minute * 5}}
+}
+
+// Name implements Sink.
+func (s *Slack) Name() string { return "slack" }
+
+// Notify implements Sink.
+func (s *Slack) Notify(n Notification) error {
+	if s.WebhookURL == "" {
+		return nil
+	}
+
+	color := "#439FE0"
+	if n.Severity == SeverityError {
+		color = "danger"
+	}
+
+	d, err := json.Marshal(map[string][]slackAttachment{
+		"attachments": {{
+			Fallback: n.Title + "\n" + n.Text,
+			Color:    color,
+			Title:    n.Title,
+			Text:     n.Text,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(s.WebhookURL, "application/json", bytes.NewBuffer(d))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("slack: unexpected status " + resp.Status)
+	}
+
+	return nil
+}
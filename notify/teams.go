@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type teamsMessageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// Teams delivers notifications to a Microsoft Teams incoming webhook as a
+// MessageCard.
+type Teams struct {
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+// NewTeams returns a Teams sink posting to webhookURL.
+func NewTeams(webhookURL string) *Teams {
+	return &Teams{WebhookURL: webhookURL, HTTPClient: &http.Client{Timeout: time.Minute}}
+}
+
+// Name implements Sink.
+func (t *Teams) Name() string { return "teams" }
+
+// Notify implements Sink.
+func (t *Teams) Notify(n Notification) error {
+	if t.WebhookURL == "" {
+		return nil
+	}
+
+	color := "439FE0"
+	if n.Severity == SeverityError {
+		color = "FF0000"
+	}
+
+	body, err := json.Marshal(teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		Summary:    n.Title,
+		ThemeColor: color,
+		Title:      n.Title,
+		Text:       n.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := t.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(t.WebhookURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("teams: unexpected status " + resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// webhookPayload is the JSON body posted to a generic Webhook sink.
+type webhookPayload struct {
+	Severity  Severity `json:"severity"`
+	Title     string   `json:"title"`
+	Text      string   `json:"text"`
+	BucketKey string   `json:"bucket_key"`
+	MD5Hash   string   `json:"md5_hash"`
+	Engine    string   `json:"engine"`
+	Virus     string   `json:"virus"`
+}
+
+// Webhook delivers notifications as a plain JSON POST, signed with an
+// HMAC-SHA256 signature in the X-Bitscan-Signature header so receivers can
+// verify the request came from this bitscan instance.
+type Webhook struct {
+	URL        string
+	Secret     string
+	HTTPClient *http.Client
+}
+
+// NewWebhook returns a Webhook sink posting signed notifications to url.
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{URL: url, Secret: secret, HTTPClient: &http.Client{Timeout: time.Second * 10}}
+}
+
+// Name implements Sink.
+func (w *Webhook) Name() string { return "webhook" }
+
+// Notify implements Sink.
+func (w *Webhook) Notify(n Notification) error {
+	if w.URL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Severity:  n.Severity,
+		Title:     n.Title,
+		Text:      n.Text,
+		BucketKey: n.BucketKey,
+		MD5Hash:   n.MD5Hash,
+		Engine:    n.Engine,
+		Virus:     n.Virus,
+	})
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bitscan-Signature", signature)
+
+	client := w.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("webhook: unexpected status " + resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSignsBody(t *testing.T) {
+	var gotBody []byte
+	var gotSig string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		gotSig = r.Header.Get("X-Bitscan-Signature")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "sekret")
+	if err := w.Notify(Notification{Severity: SeverityPositive, Title: "t", Text: "body"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("sekret"))
+	mac.Write(gotBody)
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if gotSig != want {
+		t.Fatalf("signature mismatch: got %s want %s", gotSig, want)
+	}
+}
+
+func TestWebhookReportsNonSuccessStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "sekret")
+	if err := w.Notify(Notification{}); err == nil {
+		t.Fatal("expected an error for a non-2xx response")
+	}
+}
+
+func TestWebhookNoopsWhenUnconfigured(t *testing.T) {
+	w := NewWebhook("", "sekret")
+	if err := w.Notify(Notification{}); err != nil {
+		t.Fatalf("expected a no-op, got error: %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+// Package queue implements a bounded worker pool fronted by a durable
+// on-disk job list, so a burst of scan requests can't spawn an unbounded
+// number of goroutines or exhaust downstream scanner connections, and
+// accepted jobs survive a process restart.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/dchest/uniuri"
+)
+
+var (
+	bucketPending    = []byte("pending")
+	bucketDeadLetter = []byte("dead-letter")
+)
+
+// maxDeadLetters bounds how many dead-letter entries Status reports, so a
+// long-running queue with many permanent failures doesn't grow the status
+// response unboundedly.
+const maxDeadLetters = 20
+
+// Job is a single unit of work persisted in the queue.
+type Job struct {
+	ID         string    `json:"id"`
+	Payload    []byte    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Handler processes a single job's payload. Returning an error marks the
+// job for retry, or for the dead-letter list once Options.MaxAttempts is
+// exceeded.
+type Handler func(payload []byte) error
+
+// Options configures a Queue.
+type Options struct {
+	// Workers bounds how many jobs run concurrently.
+	Workers int
+
+	// MaxAttempts is how many times a failing job is retried before being
+	// moved to the dead-letter list.
+	MaxAttempts int
+
+	// Backoff is the base delay between retries of a given job; it doubles
+	// with each attempt.
+	Backoff time.Duration
+
+	// OnPersistError is called when the queue fails to persist state about
+	// a job (e.g. the BoltDB write itself fails). May be nil.
+	OnPersistError func(err error)
+}
+
+// Queue is a bounded worker pool backed by a BoltDB-persisted job list.
+//
+// Enqueue only ever persists a job and appends it to an in-memory ready
+// queue guarded by mu/cond; it never blocks on worker availability, so a
+// burst of callers can't back up into blocked HTTP handler goroutines the
+// way a direct, bounded channel send would.
+type Queue struct {
+	db      *bolt.DB
+	handler Handler
+	opts    Options
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ready  []Job
+	closed bool
+
+	inFlight int
+
+	wg sync.WaitGroup
+}
+
+// Open opens (or creates) the BoltDB-backed queue at path and starts its
+// worker pool, re-enqueuing any jobs left pending from a previous run.
+func Open(path string, handler Handler, opts Options) (*Queue, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second * 2
+	}
+
+	db, err := bolt.Open(path, 0660, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, errors.New("queue: failed to open database: " + err.Error())
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketPending); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketDeadLetter)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.New("queue: failed to create buckets: " + err.Error())
+	}
+
+	q := &Queue{
+		db:      db,
+		handler: handler,
+		opts:    opts,
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	q.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go q.worker()
+	}
+
+	if err := q.restorePending(); err != nil {
+		q.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// restorePending re-dispatches every job still in the pending bucket, so
+// work accepted before a restart is not lost.
+func (q *Queue) restorePending() error {
+	var jobs []Job
+
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).ForEach(func(_, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return errors.New("queue: failed to restore pending jobs: " + err.Error())
+	}
+
+	for _, job := range jobs {
+		q.dispatch(job)
+	}
+
+	return nil
+}
+
+// Enqueue persists payload durably and schedules it for processing,
+// returning the job ID a client can later poll for via Status.
+func (q *Queue) Enqueue(payload []byte) (string, error) {
+	job := Job{
+		ID:         uniuri.NewLen(uniuri.UUIDLen),
+		Payload:    payload,
+		EnqueuedAt: time.Now(),
+	}
+
+	if err := q.put(job); err != nil {
+		return "", err
+	}
+
+	q.dispatch(job)
+	return job.ID, nil
+}
+
+// dispatch adds job to the in-memory ready queue and wakes a worker to pick
+// it up. It never blocks and is a no-op once Close has been called; job has
+// already been durably persisted by put by the time dispatch is reached, so
+// dropping it here only means it will be picked up by restorePending on the
+// next Open instead of by this process.
+func (q *Queue) dispatch(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	q.ready = append(q.ready, job)
+	q.cond.Signal()
+}
+
+// next blocks until a job is ready to run or the queue has been closed.
+func (q *Queue) next() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.ready) == 0 {
+		return Job{}, false
+	}
+
+	job := q.ready[0]
+	q.ready = q.ready[1:]
+	return job, true
+}
+
+// put (re-)writes job into the pending bucket.
+func (q *Queue) put(job Job) error {
+	d, err := json.Marshal(job)
+	if err != nil {
+		return errors.New("queue: failed to marshal job: " + err.Error())
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).Put([]byte(job.ID), d)
+	})
+}
+
+// remove deletes job from the pending bucket once it's done (successfully
+// or permanently failed).
+func (q *Queue) remove(id string) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).Delete([]byte(id))
+	})
+}
+
+// deadLetter moves job to the dead-letter bucket after it exhausts retries.
+func (q *Queue) deadLetter(job Job) error {
+	d, err := json.Marshal(job)
+	if err != nil {
+		return errors.New("queue: failed to marshal job: " + err.Error())
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketPending).Delete([]byte(job.ID)); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketDeadLetter).Put([]byte(job.ID), d)
+	})
+}
+
+// worker pulls jobs off the ready queue and runs them through q.handler,
+// retrying with backoff until MaxAttempts is exhausted, until the queue is
+// closed.
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for {
+		job, ok := q.next()
+		if !ok {
+			return
+		}
+
+		q.mu.Lock()
+		q.inFlight++
+		q.mu.Unlock()
+
+		err := q.handler(job.Payload)
+
+		q.mu.Lock()
+		q.inFlight--
+		q.mu.Unlock()
+
+		if err == nil {
+			if err := q.remove(job.ID); err != nil {
+				q.reportPersistError(err)
+			}
+			continue
+		}
+
+		job.Attempts++
+		job.LastError = err.Error()
+
+		if job.Attempts >= q.opts.MaxAttempts {
+			if err := q.deadLetter(job); err != nil {
+				q.reportPersistError(err)
+			}
+			continue
+		}
+
+		if err := q.put(job); err != nil {
+			q.reportPersistError(err)
+		}
+
+		delay := q.opts.Backoff * time.Duration(1<<uint(job.Attempts-1))
+		retry := job
+		go func() {
+			time.Sleep(delay)
+			q.dispatch(retry)
+		}()
+	}
+}
+
+func (q *Queue) reportPersistError(err error) {
+	if q.opts.OnPersistError != nil {
+		q.opts.OnPersistError(err)
+	}
+}
+
+// Status summarizes the queue's current state for a status endpoint.
+type Status struct {
+	QueueDepth  int   `json:"queue_depth"`
+	InFlight    int   `json:"in_flight"`
+	DeadLetters []Job `json:"dead_letters"`
+}
+
+// Status reports the queue depth, in-flight count, and the most recent
+// dead-lettered jobs. QueueDepth counts only jobs waiting to be dispatched;
+// a job stays in the pending bucket for the whole time it's in flight (it's
+// only removed once its handler returns), so InFlight is subtracted back
+// out rather than double-counted as backlog.
+func (q *Queue) Status() (*Status, error) {
+	status := &Status{}
+
+	q.mu.Lock()
+	status.InFlight = q.inFlight
+	q.mu.Unlock()
+
+	err := q.db.View(func(tx *bolt.Tx) error {
+		status.QueueDepth = tx.Bucket(bucketPending).Stats().KeyN - status.InFlight
+		if status.QueueDepth < 0 {
+			status.QueueDepth = 0
+		}
+
+		c := tx.Bucket(bucketDeadLetter).Cursor()
+		for k, v := c.Last(); k != nil && len(status.DeadLetters) < maxDeadLetters; k, v = c.Prev() {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			status.DeadLetters = append(status.DeadLetters, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("queue: failed to read status: " + err.Error())
+	}
+
+	return status, nil
+}
+
+// Close stops accepting new work, waits for in-flight jobs to finish, and
+// closes the underlying database. Pending retry goroutines that wake up
+// after Close has started see the queue closed in dispatch and drop their
+// job instead of touching the now-closed database; it stays durable in the
+// pending bucket and is restored the next time Open runs.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	return q.db.Close()
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openTestQueue(t *testing.T, handler Handler, opts Options) *Queue {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "queue_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	q, err := Open(filepath.Join(dir, "queue.db"), handler, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	return q
+}
+
+// TestEnqueueDoesNotBlockOnBusyWorkers guards against Enqueue regressing
+// into a blocking channel send: with a single worker stuck processing the
+// first job, a second Enqueue call must still return immediately.
+func TestEnqueueDoesNotBlockOnBusyWorkers(t *testing.T) {
+	release := make(chan struct{})
+	q := openTestQueue(t, func(payload []byte) error {
+		<-release
+		return nil
+	}, Options{Workers: 1})
+	defer close(release)
+
+	if _, err := q.Enqueue([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		if _, err := q.Enqueue([]byte("second")); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue blocked while the single worker was busy")
+	}
+}
+
+// TestRetryWithBackoffThenDeadLetter exercises a failing job through every
+// retry until it's moved to the dead-letter list.
+func TestRetryWithBackoffThenDeadLetter(t *testing.T) {
+	var attempts int32
+	q := openTestQueue(t, func(payload []byte) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("always fails")
+	}, Options{Workers: 1, MaxAttempts: 2, Backoff: time.Millisecond})
+
+	if _, err := q.Enqueue([]byte("job")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := q.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(status.DeadLetters) == 1 {
+			if got := atomic.LoadInt32(&attempts); got != 2 {
+				t.Fatalf("expected 2 attempts before dead-lettering, got %d", got)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job was never dead-lettered")
+}
+
+// TestStatusQueueDepthExcludesInFlightJobs guards against QueueDepth
+// double-counting a job that's currently being handled: it stays in the
+// pending bucket for the whole time it's in flight, so Status must
+// subtract InFlight back out rather than reporting it as backlog too.
+func TestStatusQueueDepthExcludesInFlightJobs(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q := openTestQueue(t, func(payload []byte) error {
+		close(started)
+		<-release
+		return nil
+	}, Options{Workers: 1})
+	defer close(release)
+
+	if _, err := q.Enqueue([]byte("job")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("worker never picked up the job")
+	}
+
+	status, err := q.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.InFlight != 1 {
+		t.Fatalf("expected InFlight=1, got %d", status.InFlight)
+	}
+	if status.QueueDepth != 0 {
+		t.Fatalf("expected the in-flight job to be excluded from QueueDepth, got %d", status.QueueDepth)
+	}
+}
+
+// TestCloseDoesNotPanicOnPendingRetry guards against the retry goroutine
+// sending on a channel/queue torn down by Close while its backoff sleep is
+// still pending.
+func TestCloseDoesNotPanicOnPendingRetry(t *testing.T) {
+	q := openTestQueue(t, func(payload []byte) error {
+		return errors.New("always fails")
+	}, Options{Workers: 1, MaxAttempts: 5, Backoff: time.Hour})
+
+	if _, err := q.Enqueue([]byte("job")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the worker a moment to fail the job once and schedule its
+	// (long-delayed) retry before Close runs out from under it.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
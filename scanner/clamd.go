@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sheenobu/go-clamscan"
+)
+
+// clamdChunkSize is the amount of data sent per INSTREAM chunk.
+const clamdChunkSize = 64 * 1024
+
+// Clamd is a Backend that drives a clamd daemon. With Network/Address left
+// unset it shells out through the clamscan library's file-based protocol,
+// the integration bitscan has always used. With Network/Address set, it
+// instead streams bytes straight to clamd over its INSTREAM protocol,
+// implementing StreamBackend so large objects never need to touch disk.
+type Clamd struct {
+	// Options are passed through to clamscan.Scan when Network is empty.
+	Options clamscan.Options
+
+	// Network is "unix" or "tcp". When set, scans are streamed to clamd
+	// over INSTREAM instead of going through clamscan.
+	Network string
+
+	// Address is the UNIX socket path or "host:port" TCP address to dial
+	// when Network is set.
+	Address string
+
+	// Timeout bounds the dial and scan round-trip when streaming.
+	Timeout time.Duration
+}
+
+// NewClamd returns a file-based Clamd backend using the supplied clamscan
+// options. Use the Clamd struct directly to configure INSTREAM streaming.
+func NewClamd(options clamscan.Options) *Clamd {
+	return &Clamd{Options: options}
+}
+
+// Name implements Backend.
+func (c *Clamd) Name() string { return "clamd" }
+
+// CanStream reports whether this Clamd is configured to stream over
+// INSTREAM (Network set) rather than through the file-based clamscan
+// library, letting Pipeline.Streamable answer without calling ScanReader.
+func (c *Clamd) CanStream() bool { return c.Network != "" }
+
+// Scan implements Backend.
+func (c *Clamd) Scan(path string) (*Result, error) {
+	if c.Network == "" {
+		return c.scanFile(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("clamd: failed to open file: " + err.Error())
+	}
+	defer file.Close()
+
+	return c.ScanReader(file)
+}
+
+// scanFile runs the legacy clamscan-library file-based scan.
+func (c *Clamd) scanFile(path string) (*Result, error) {
+	resCh, err := clamscan.Scan(&c.Options, path)
+	if err != nil {
+		return nil, errors.New("failed to scan file: " + err.Error())
+	}
+
+	res := <-resCh
+	if res == nil {
+		return nil, errors.New("clamd returned no result")
+	}
+	if res.Error != nil {
+		return nil, errors.New("clamd: " + res.Error.Error())
+	}
+
+	return &Result{Found: res.Found, Virus: res.Virus}, nil
+}
+
+// ScanReader implements StreamBackend by streaming r to clamd over its
+// INSTREAM protocol: a sequence of 4-byte big-endian length-prefixed
+// chunks, terminated by a zero-length chunk.
+func (c *Clamd) ScanReader(r io.Reader) (*Result, error) {
+	if c.Network == "" {
+		return nil, ErrNotStreamable
+	}
+
+	conn, err := net.DialTimeout(c.Network, c.Address, c.Timeout)
+	if err != nil {
+		return nil, errors.New("clamd: failed to dial " + c.Address + ": " + err.Error())
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\000")); err != nil {
+		return nil, errors.New("clamd: failed to send INSTREAM command: " + err.Error())
+	}
+
+	var lenBuf [4]byte
+	buf := make([]byte, clamdChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(lenBuf[:], uint32(n))
+			if _, err := conn.Write(lenBuf[:]); err != nil {
+				return nil, errors.New("clamd: failed to write chunk size: " + err.Error())
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return nil, errors.New("clamd: failed to write chunk: " + err.Error())
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, errors.New("clamd: failed to read file body: " + readErr.Error())
+		}
+	}
+
+	binary.BigEndian.PutUint32(lenBuf[:], 0)
+	if _, err := conn.Write(lenBuf[:]); err != nil {
+		return nil, errors.New("clamd: failed to write terminating chunk: " + err.Error())
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, errors.New("clamd: failed to read reply: " + err.Error())
+	}
+	reply = strings.TrimRight(reply, "\x00\r\n")
+
+	if strings.HasSuffix(reply, "FOUND") {
+		virus := strings.TrimSpace(strings.TrimSuffix(reply, "FOUND"))
+		virus = strings.TrimPrefix(virus, "stream:")
+		return &Result{Found: true, Virus: strings.TrimSpace(virus)}, nil
+	}
+
+	return &Result{Found: false}, nil
+}
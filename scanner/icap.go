@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ICAP is a Backend that submits a file to an ICAP RESPMOD service, the
+// protocol most enterprise AV appliances (e.g. Symantec, McAfee, Kaspersky
+// ICAP gateways) speak.
+type ICAP struct {
+	// Address is the "host:port" the ICAP service listens on.
+	Address string
+
+	// Service is the ICAP service name, e.g. "avscan".
+	Service string
+
+	// Timeout bounds the dial and request/response round-trip.
+	Timeout time.Duration
+}
+
+// Name implements Backend.
+func (i *ICAP) Name() string { return "icap" }
+
+// Scan implements Backend. It opens path, submits it for RESPMOD scanning,
+// and interprets a 200 response as clean and a 403 response as blocked.
+func (i *ICAP) Scan(path string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("icap: failed to open file: " + err.Error())
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.New("icap: failed to stat file: " + err.Error())
+	}
+
+	conn, err := net.DialTimeout("tcp", i.Address, i.Timeout)
+	if err != nil {
+		return nil, errors.New("icap: failed to dial " + i.Address + ": " + err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(i.Timeout))
+
+	req := fmt.Sprintf(
+		"RESPMOD icap://%s/%s ICAP/1.0\r\nHost: %s\r\nEncapsulated: res-body=0\r\n\r\n",
+		i.Address, i.Service, i.Address)
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, errors.New("icap: failed to write request headers: " + err.Error())
+	}
+
+	if _, err := fmt.Fprintf(conn, "%x\r\n", info.Size()); err != nil {
+		return nil, errors.New("icap: failed to write chunk size: " + err.Error())
+	}
+	if _, err := file.WriteTo(conn); err != nil {
+		return nil, errors.New("icap: failed to stream file body: " + err.Error())
+	}
+	if _, err := conn.Write([]byte("\r\n0\r\n\r\n")); err != nil {
+		return nil, errors.New("icap: failed to write final chunk: " + err.Error())
+	}
+
+	reader := bufio.NewReader(conn)
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, errors.New("icap: failed to read response: " + err.Error())
+	}
+
+	var protocol string
+	var status int
+	if _, err := fmt.Sscanf(statusLine, "%s %d", &protocol, &status); err != nil {
+		return nil, errors.New("icap: malformed status line: " + statusLine)
+	}
+
+	switch status {
+	case 200:
+		return &Result{Found: false}, nil
+	case 403:
+		virus := "blocked by " + i.Service
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			if name, ok := parseICAPThreatHeader(line); ok {
+				virus = name
+				break
+			}
+		}
+		return &Result{Found: true, Virus: virus}, nil
+	default:
+		return nil, errors.New("icap: unexpected status " + strconv.Itoa(status))
+	}
+}
+
+// parseICAPThreatHeader extracts the threat name from the common
+// "X-Infection-Found" / "X-Virus-ID" response headers ICAP appliances use.
+func parseICAPThreatHeader(line string) (string, bool) {
+	for _, prefix := range []string{"X-Infection-Found:", "X-Virus-ID:"} {
+		if len(line) > len(prefix) && line[:len(prefix)] == prefix {
+			return trimCRLF(line[len(prefix):]), true
+		}
+	}
+	return "", false
+}
+
+func trimCRLF(s string) string {
+	for len(s) > 0 && (s[0] == ' ') {
+		s = s[1:]
+	}
+	for len(s) > 0 && (s[len(s)-1] == '\r' || s[len(s)-1] == '\n') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
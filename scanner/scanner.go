@@ -0,0 +1,223 @@
+// Package scanner defines the pluggable backend interface bitscan uses to
+// inspect objects for malware, along with a Pipeline that chains several
+// backends together.
+package scanner
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotStreamable is returned by Pipeline.ScanStream when the pipeline
+// cannot be satisfied from a single pass over an io.Reader: either it has
+// more than one backend (each needs its own read of the bytes), or its one
+// backend does not implement StreamBackend. Callers should fall back to
+// writing the reader to a file and using ScanWithHash instead.
+var ErrNotStreamable = errors.New("scanner: pipeline cannot scan from a stream")
+
+// StreamBackend is implemented by backends that can scan bytes directly
+// from an io.Reader, without the caller first spooling them to disk.
+type StreamBackend interface {
+	Backend
+
+	// ScanReader behaves like Scan but reads the file's contents from r
+	// instead of a path.
+	ScanReader(r io.Reader) (*Result, error)
+}
+
+// streamConfigurable is implemented by a StreamBackend whose ability to
+// stream depends on its runtime configuration, not just which methods it
+// has (e.g. Clamd implements StreamBackend unconditionally, but can only
+// actually stream when Network is set). Streamable uses this to give
+// callers a cheap, side-effect-free answer before committing to a stream.
+type streamConfigurable interface {
+	StreamBackend
+
+	// CanStream reports whether the backend is currently configured to
+	// scan from a reader, without attempting to do so.
+	CanStream() bool
+}
+
+// Result represents the outcome of scanning a single file with a Backend.
+type Result struct {
+	// Engine is the name of the backend that produced this result.
+	Engine string
+
+	// Found indicates whether the backend considers the file malicious.
+	Found bool
+
+	// Virus is the signature or rule name that matched, if Found is true.
+	Virus string
+
+	// Elapsed is how long the backend took to scan the file.
+	Elapsed time.Duration
+}
+
+// Backend is implemented by any scan engine bitscan can drive: a local
+// clamd daemon, an ICAP-speaking AV appliance, a YARA rule matcher, or a
+// hash-lookup service such as VirusTotal.
+type Backend interface {
+	// Name identifies the backend in logs, metrics and notifications.
+	Name() string
+
+	// Scan inspects the file at path and reports whether it is malicious.
+	Scan(path string) (*Result, error)
+}
+
+// AsyncBackend is implemented by backends that can scan a batch of paths
+// more efficiently together than one at a time, such as a remote API with
+// its own concurrency.
+type AsyncBackend interface {
+	Backend
+
+	// ScanBatch scans every path and returns one Result per path, in order.
+	ScanBatch(paths []string) ([]*Result, error)
+}
+
+// HashBackend is implemented by backends that can produce a verdict from a
+// content hash alone, such as a VirusTotal lookup, letting the pipeline
+// short-circuit before the file is even downloaded.
+type HashBackend interface {
+	Backend
+
+	// ScanHash looks up md5Hash and reports a result without needing the
+	// file on disk. known reports whether the backend had any verdict for
+	// this hash at all; when known is false, result is nil and the
+	// pipeline falls through to the next backend.
+	ScanHash(md5Hash string) (result *Result, known bool, err error)
+}
+
+// Pipeline runs an ordered list of backends against a file, stopping as
+// soon as one of them reports a positive hit so later, typically slower or
+// more expensive, stages are short-circuited.
+type Pipeline struct {
+	backends []Backend
+}
+
+// NewPipeline builds a Pipeline that runs backends in the given order.
+func NewPipeline(backends ...Backend) *Pipeline {
+	return &Pipeline{backends: backends}
+}
+
+// Scan runs path through every backend in order, returning the first
+// positive Result. If no backend finds anything, Scan returns a clean
+// Result with Engine set to "none".
+func (p *Pipeline) Scan(path string) (*Result, error) {
+	return p.ScanWithHash(path, "")
+}
+
+// ScanWithHash behaves like Scan, except that backends implementing
+// HashBackend are first consulted with md5Hash (when non-empty) and only
+// fall through to a full file scan if they have no verdict for that hash.
+func (p *Pipeline) ScanWithHash(path, md5Hash string) (*Result, error) {
+	if len(p.backends) == 0 {
+		return nil, errors.New("scanner: pipeline has no backends configured")
+	}
+
+	for _, backend := range p.backends {
+		start := time.Now()
+
+		if md5Hash != "" {
+			if hb, ok := backend.(HashBackend); ok {
+				res, known, err := hb.ScanHash(md5Hash)
+				if err != nil {
+					return nil, errors.New(backend.Name() + ": " + err.Error())
+				}
+				if known {
+					if res.Engine == "" {
+						res.Engine = backend.Name()
+					}
+					if res.Elapsed == 0 {
+						res.Elapsed = time.Since(start)
+					}
+					if res.Found {
+						return res, nil
+					}
+					continue
+				}
+				// known is false: this backend has no verdict for the
+				// hash. Move on to the next pipeline stage instead of
+				// falling into backend.Scan(path) on this same backend,
+				// which a hash-only backend like VirusTotal can't satisfy.
+				continue
+			}
+		}
+
+		res, err := backend.Scan(path)
+		if err != nil {
+			return nil, errors.New(backend.Name() + ": " + err.Error())
+		}
+
+		if res.Engine == "" {
+			res.Engine = backend.Name()
+		}
+		if res.Elapsed == 0 {
+			res.Elapsed = time.Since(start)
+		}
+
+		if res.Found {
+			return res, nil
+		}
+	}
+
+	return &Result{Engine: "none"}, nil
+}
+
+// Streamable reports, without side effects, whether ScanStream can
+// currently be satisfied: the pipeline must resolve to exactly one
+// backend, and that backend must both implement StreamBackend and (for
+// backends whose streaming support depends on configuration, such as
+// Clamd) report that it's configured to stream. Callers should use this to
+// decide whether it's worth opening a stream at all, rather than opening
+// one speculatively and having to unwind it if ScanStream can't use it.
+func (p *Pipeline) Streamable() bool {
+	if len(p.backends) != 1 {
+		return false
+	}
+
+	switch b := p.backends[0].(type) {
+	case streamConfigurable:
+		return b.CanStream()
+	case StreamBackend:
+		return true
+	default:
+		return false
+	}
+}
+
+// ScanStream runs r through the pipeline's single backend, provided that
+// backend implements StreamBackend, avoiding the cost of writing large
+// objects to disk before scanning them. It returns ErrNotStreamable for any
+// pipeline with more than one backend, whose one backend cannot consume a
+// reader directly, or whose ScanReader reports ErrNotStreamable itself
+// (e.g. a backend that implements StreamBackend but isn't currently
+// configured to stream) — callers should fall back to spooling to disk.
+func (p *Pipeline) ScanStream(r io.Reader) (*Result, error) {
+	if len(p.backends) != 1 {
+		return nil, ErrNotStreamable
+	}
+
+	backend, ok := p.backends[0].(StreamBackend)
+	if !ok {
+		return nil, ErrNotStreamable
+	}
+
+	start := time.Now()
+	res, err := backend.ScanReader(r)
+	if err != nil {
+		if err == ErrNotStreamable {
+			return nil, ErrNotStreamable
+		}
+		return nil, errors.New(backend.Name() + ": " + err.Error())
+	}
+
+	if res.Engine == "" {
+		res.Engine = backend.Name()
+	}
+	if res.Elapsed == 0 {
+		res.Elapsed = time.Since(start)
+	}
+
+	return res, nil
+}
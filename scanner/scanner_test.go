@@ -0,0 +1,176 @@
+package scanner
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type fakeBackend struct {
+	name   string
+	result *Result
+	err    error
+	calls  *int
+}
+
+func (f *fakeBackend) Name() string { return f.name }
+
+func (f *fakeBackend) Scan(path string) (*Result, error) {
+	if f.calls != nil {
+		*f.calls++
+	}
+	return f.result, f.err
+}
+
+func TestPipelineScanShortCircuitsOnFirstPositive(t *testing.T) {
+	var secondCalls int
+	first := &fakeBackend{name: "first", result: &Result{Found: true, Virus: "EICAR"}}
+	second := &fakeBackend{name: "second", result: &Result{Found: false}, calls: &secondCalls}
+
+	res, err := NewPipeline(first, second).Scan("/tmp/whatever")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Found || res.Engine != "first" || res.Virus != "EICAR" {
+		t.Fatalf("expected first backend's positive result, got %+v", res)
+	}
+	if secondCalls != 0 {
+		t.Fatalf("expected second backend to be skipped, got %d calls", secondCalls)
+	}
+}
+
+func TestPipelineScanCleanWhenNoBackendFindsAnything(t *testing.T) {
+	res, err := NewPipeline(&fakeBackend{name: "only", result: &Result{Found: false}}).Scan("/tmp/whatever")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Found {
+		t.Fatalf("expected a clean result, got %+v", res)
+	}
+}
+
+func TestPipelineScanEmptyPipelineErrors(t *testing.T) {
+	if _, err := NewPipeline().Scan("/tmp/whatever"); err == nil {
+		t.Fatal("expected an error for a pipeline with no backends")
+	}
+}
+
+type fakeStreamBackend struct {
+	fakeBackend
+	streamErr error
+}
+
+func (f *fakeStreamBackend) ScanReader(r io.Reader) (*Result, error) {
+	return nil, f.streamErr
+}
+
+func TestPipelineScanStreamPropagatesErrNotStreamable(t *testing.T) {
+	backend := &fakeStreamBackend{fakeBackend: fakeBackend{name: "stream"}, streamErr: ErrNotStreamable}
+
+	_, err := NewPipeline(backend).ScanStream(strings.NewReader("data"))
+	if err != ErrNotStreamable {
+		t.Fatalf("expected ErrNotStreamable, got %v", err)
+	}
+}
+
+func TestPipelineScanStreamRejectsMultipleBackends(t *testing.T) {
+	a := &fakeBackend{name: "a", result: &Result{}}
+	b := &fakeBackend{name: "b", result: &Result{}}
+
+	_, err := NewPipeline(a, b).ScanStream(strings.NewReader("data"))
+	if err != ErrNotStreamable {
+		t.Fatalf("expected ErrNotStreamable for a multi-backend pipeline, got %v", err)
+	}
+}
+
+type fakeHashBackend struct {
+	fakeBackend
+	hashResult *Result
+	known      bool
+	hashErr    error
+	hashCalls  int
+}
+
+func (f *fakeHashBackend) ScanHash(md5Hash string) (*Result, bool, error) {
+	f.hashCalls++
+	return f.hashResult, f.known, f.hashErr
+}
+
+func TestPipelineScanWithHashSkipsToNextBackendWhenUnknown(t *testing.T) {
+	var scanCalls int
+	unknown := &fakeHashBackend{fakeBackend: fakeBackend{name: "unknown", calls: &scanCalls}, known: false}
+	next := &fakeBackend{name: "next", result: &Result{Found: true, Virus: "EICAR"}}
+
+	res, err := NewPipeline(unknown, next).ScanWithHash("/tmp/whatever", "deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Found || res.Engine != "next" {
+		t.Fatalf("expected the next backend's positive result, got %+v", res)
+	}
+	if scanCalls != 0 {
+		t.Fatalf("expected the hash backend's Scan to be skipped entirely, got %d calls", scanCalls)
+	}
+}
+
+func TestPipelineScanWithHashCleanWhenOnlyBackendDoesntKnowHash(t *testing.T) {
+	var scanCalls int
+	unknown := &fakeHashBackend{fakeBackend: fakeBackend{name: "unknown", calls: &scanCalls}, known: false}
+
+	res, err := NewPipeline(unknown).ScanWithHash("/tmp/whatever", "deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Found {
+		t.Fatalf("expected a clean result, got %+v", res)
+	}
+	if scanCalls != 0 {
+		t.Fatalf("expected the hash backend's Scan to be skipped entirely, got %d calls", scanCalls)
+	}
+}
+
+func TestPipelineScanWithHashUsesHashResultWhenKnown(t *testing.T) {
+	known := &fakeHashBackend{fakeBackend: fakeBackend{name: "vt"}, known: true, hashResult: &Result{Found: true, Virus: "EICAR"}}
+
+	res, err := NewPipeline(known).ScanWithHash("/tmp/whatever", "deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Found || res.Engine != "vt" {
+		t.Fatalf("expected the hash backend's positive result, got %+v", res)
+	}
+}
+
+type fakeConfigurableStreamBackend struct {
+	fakeStreamBackend
+	canStream bool
+}
+
+func (f *fakeConfigurableStreamBackend) CanStream() bool { return f.canStream }
+
+func TestPipelineStreamableRejectsMultipleBackends(t *testing.T) {
+	a := &fakeStreamBackend{fakeBackend: fakeBackend{name: "a"}}
+	b := &fakeStreamBackend{fakeBackend: fakeBackend{name: "b"}}
+
+	if NewPipeline(a, b).Streamable() {
+		t.Fatal("expected a multi-backend pipeline to be unstreamable")
+	}
+}
+
+func TestPipelineStreamableRejectsNonStreamBackend(t *testing.T) {
+	if NewPipeline(&fakeBackend{name: "only"}).Streamable() {
+		t.Fatal("expected a non-StreamBackend pipeline to be unstreamable")
+	}
+}
+
+func TestPipelineStreamableChecksCanStreamWhenConfigurable(t *testing.T) {
+	unconfigured := &fakeConfigurableStreamBackend{fakeStreamBackend: fakeStreamBackend{fakeBackend: fakeBackend{name: "clamd"}}, canStream: false}
+	if NewPipeline(unconfigured).Streamable() {
+		t.Fatal("expected an unconfigured streamConfigurable backend to be unstreamable")
+	}
+
+	configured := &fakeConfigurableStreamBackend{fakeStreamBackend: fakeStreamBackend{fakeBackend: fakeBackend{name: "clamd"}}, canStream: true}
+	if !NewPipeline(configured).Streamable() {
+		t.Fatal("expected a configured streamConfigurable backend to be streamable")
+	}
+}
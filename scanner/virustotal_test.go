@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// redirectTransport rewrites every outgoing request to hit server instead of
+// the hardcoded virusTotalAPIURL, since VirusTotal has no injectable base
+// URL of its own.
+type redirectTransport struct {
+	server *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestVirusTotal(t *testing.T, server *httptest.Server) *VirusTotal {
+	t.Helper()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	return &VirusTotal{
+		APIKey: "test",
+		Client: &http.Client{Transport: &redirectTransport{server: serverURL}},
+	}
+}
+
+func TestVirusTotalScanHashUnknown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_code": 0}`)
+	}))
+	defer server.Close()
+
+	res, known, err := newTestVirusTotal(t, server).ScanHash("deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if known {
+		t.Fatalf("expected known=false for an unseen hash, got result %+v", res)
+	}
+}
+
+func TestVirusTotalScanHashClean(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_code": 1, "positives": 0, "total": 60}`)
+	}))
+	defer server.Close()
+
+	res, known, err := newTestVirusTotal(t, server).ScanHash("deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !known || res.Found {
+		t.Fatalf("expected a known, clean result, got known=%v res=%+v", known, res)
+	}
+}
+
+func TestVirusTotalScanHashFlagged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_code": 1, "positives": 12, "total": 60, "scan_id": "abc"}`)
+	}))
+	defer server.Close()
+
+	res, known, err := newTestVirusTotal(t, server).ScanHash("deadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !known || !res.Found {
+		t.Fatalf("expected a known, positive result, got known=%v res=%+v", known, res)
+	}
+}
+
+func TestVirusTotalScanHashesFileAndReportsCleanWhenUnseen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_code": 0}`)
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "virustotal-scan-test")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	res, err := newTestVirusTotal(t, server).Scan(file.Name())
+	if err != nil {
+		t.Fatalf("expected a no-verdict scan to come back clean, not an error: %v", err)
+	}
+	if res.Found {
+		t.Fatalf("expected a clean result, got %+v", res)
+	}
+}
+
+func TestVirusTotalScanFlaggedFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_code": 1, "positives": 5, "total": 60}`)
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "virustotal-scan-test")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	res, err := newTestVirusTotal(t, server).Scan(file.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Found {
+		t.Fatalf("expected a positive result, got %+v", res)
+	}
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import "errors"
+
+// YARAMatcher is implemented by a compiled YARA ruleset. It exists so the
+// YARA backend does not force a cgo dependency on callers that do not build
+// with YARA support; the real implementation lives behind a build tag in
+// whatever binary links libyara.
+type YARAMatcher interface {
+	// MatchFile returns the names of every rule that matched path.
+	MatchFile(path string) ([]string, error)
+}
+
+// YARA is a Backend that matches files against a set of custom
+// indicator-of-compromise rules, for detections clamd's signature database
+// does not cover.
+type YARA struct {
+	Matcher YARAMatcher
+}
+
+// NewYARA returns a YARA backend using the supplied rule matcher.
+func NewYARA(matcher YARAMatcher) *YARA {
+	return &YARA{Matcher: matcher}
+}
+
+// Name implements Backend.
+func (y *YARA) Name() string { return "yara" }
+
+// Scan implements Backend.
+func (y *YARA) Scan(path string) (*Result, error) {
+	if y.Matcher == nil {
+		return nil, errors.New("yara: no ruleset loaded")
+	}
+
+	matches, err := y.Matcher.MatchFile(path)
+	if err != nil {
+		return nil, errors.New("yara: failed to match file: " + err.Error())
+	}
+
+	if len(matches) == 0 {
+		return &Result{Found: false}, nil
+	}
+
+	return &Result{Found: true, Virus: matches[0]}, nil
+}
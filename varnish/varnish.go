@@ -0,0 +1,83 @@
+// Package varnish issues cache-invalidation requests against a Varnish
+// cluster, so an object removed from the storage backend doesn't linger in
+// edge cache.
+package varnish
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Client purges or bans objects across a fixed list of Varnish nodes.
+type Client struct {
+	// Nodes are the base URLs of every Varnish node to invalidate against,
+	// e.g. "http://varnish-1:6081".
+	Nodes []string
+
+	// HTTPClient is used to perform requests. Defaults to a client with a
+	// 10 second timeout when nil.
+	HTTPClient *http.Client
+}
+
+// New returns a Client targeting the given Varnish nodes.
+func New(nodes []string) *Client {
+	return &Client{Nodes: nodes, HTTPClient: &http.Client{Timeout: time.Second * 10}}
+}
+
+// Purge sends a PURGE request for path to every configured node, returning
+// the first error encountered after attempting all of them.
+func (c *Client) Purge(path string) error {
+	return c.broadcast("PURGE", path, nil)
+}
+
+// Ban sends a BAN request to every configured node with the given header
+// set, for invalidating objects that can't be addressed by a single path
+// (e.g. banning on an X-Bucket-Key header).
+func (c *Client) Ban(header, value string) error {
+	return c.broadcast("BAN", "/", map[string]string{header: value})
+}
+
+// broadcast sends method/path/headers to every node, returning the first
+// error encountered (after still attempting the remaining nodes).
+func (c *Client) broadcast(method, path string, headers map[string]string) error {
+	if len(c.Nodes) == 0 {
+		return errors.New("varnish: no nodes configured")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var firstErr error
+	for _, node := range c.Nodes {
+		if err := c.request(client, method, node, path, headers); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (c *Client) request(client *http.Client, method, node, path string, headers map[string]string) error {
+	req, err := http.NewRequest(method, node+path, nil)
+	if err != nil {
+		return errors.New("varnish: failed to build request: " + err.Error())
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.New("varnish: request to " + node + " failed: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return errors.New("varnish: " + method + " to " + node + " returned " + resp.Status)
+	}
+
+	return nil
+}